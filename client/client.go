@@ -2,6 +2,8 @@ package main
 
 import (
 	"bytes"
+	"crypto/rand"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -13,12 +15,17 @@ import (
 	"github.com/gomarkdown/markdown"
 	"github.com/gomarkdown/markdown/html"
 	"github.com/gomarkdown/markdown/parser"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
 )
 
 // Note struct represents a note
 type Note struct {
-	Title string `json:"title"`
-	Body  string `json:"body"`
+	Title     string `json:"title"`
+	Body      string `json:"body"`
+	Encrypted bool   `json:"encrypted,omitempty"`
+	Salt      []byte `json:"salt,omitempty"`
+	Nonce     []byte `json:"nonce,omitempty"`
 }
 
 var (
@@ -28,20 +35,31 @@ var (
 )
 
 func main() {
-	if len(os.Args) != 5 {
-		fmt.Println("Usage: go run client.go <filename> <username> <password> <serverURL>")
+	args := os.Args[1:]
+
+	var passphrase string
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--encrypt" && i+1 < len(args) {
+			passphrase = args[i+1]
+			args = append(args[:i], args[i+2:]...)
+			break
+		}
+	}
+
+	if len(args) != 4 {
+		fmt.Println("Usage: go run client.go <filename> <username> <password> <serverURL> [--encrypt <passphrase>]")
 		return
 	}
 
-	filename := os.Args[1]
+	filename := args[0]
 	// Do not sync .notes_config file
 	if strings.HasSuffix(filename, ".notes_config") {
 		return
 	}
 
-	username = os.Args[2]
-	password = os.Args[3]
-	serverURL = os.Args[4]
+	username = args[1]
+	password = args[2]
+	serverURL = args[3]
 
 	fileContents, err := ioutil.ReadFile(filename)
 	if err != nil {
@@ -49,7 +67,31 @@ func main() {
 	}
 
 	fileStr := string(fileContents)
-	addOrUpdateNote(filename, fileStr)
+	addOrUpdateNote(filename, fileStr, passphrase)
+}
+
+// encryptBody derives a 32-byte key from the passphrase with Argon2id and
+// seals the body with XChaCha20-Poly1305 under a fresh salt and nonce, so
+// the server only ever stores ciphertext it cannot read.
+func encryptBody(passphrase, body string) (cipherBody string, salt, nonce []byte, err error) {
+	salt = make([]byte, 16)
+	if _, err = rand.Read(salt); err != nil {
+		return "", nil, nil, err
+	}
+
+	key := argon2.IDKey([]byte(passphrase), salt, 1, 64*1024, 4, 32)
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	nonce = make([]byte, chacha20poly1305.NonceSizeX)
+	if _, err = rand.Read(nonce); err != nil {
+		return "", nil, nil, err
+	}
+
+	ciphertext := aead.Seal(nil, nonce, []byte(body), nil)
+	return base64.StdEncoding.EncodeToString(ciphertext), salt, nonce, nil
 }
 
 func mdToHTML(md []byte) []byte {
@@ -67,18 +109,28 @@ func mdToHTML(md []byte) []byte {
 }
 
 // Function to add or update a note on the server
-func addOrUpdateNote(title, body string) {
+func addOrUpdateNote(title, body, passphrase string) {
 	note := Note{
 		Title: title,
 		Body:  body,
 	}
 
-	endpoint := "/sync"
-	// If filename has no extension or .md extension, use /sync endpoint
-	if !strings.Contains(title, ".") || strings.HasSuffix(title, ".md") {
+	if passphrase != "" {
+		cipherBody, salt, nonce, err := encryptBody(passphrase, body)
+		if err != nil {
+			log.Fatal("Error encrypting note:", err)
+		}
+		note.Body = cipherBody
+		note.Salt = salt
+		note.Nonce = nonce
+		note.Encrypted = true
+	} else if !strings.Contains(title, ".") || strings.HasSuffix(title, ".md") {
+		// If filename has no extension or .md extension, send it rendered as HTML
 		note.Body = string(mdToHTML([]byte(body)))
 	}
 
+	endpoint := "/sync"
+
 	// Marshal note into JSON
 	jsonData, err := json.Marshal(note)
 	if err != nil {
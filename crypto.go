@@ -0,0 +1,207 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// deriveKey stretches a passphrase into a 32-byte XChaCha20-Poly1305 key,
+// matching the parameters the client uses in client.go.
+func deriveKey(passphrase string, salt []byte) []byte {
+	return argon2.IDKey([]byte(passphrase), salt, 1, 64*1024, 4, 32)
+}
+
+// decryptCipher opens a base64-encoded ciphertext under the salt/nonce it
+// was sealed with, the common core behind decryptBody and decryptRevisionBody.
+func decryptCipher(cipherBody string, salt, nonce []byte, passphrase string) (string, error) {
+	key := deriveKey(passphrase, salt)
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return "", err
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(cipherBody)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", errors.New("wrong passphrase")
+	}
+	return string(plaintext), nil
+}
+
+// decryptBody opens the ciphertext stored on a Note with the given passphrase.
+func decryptBody(note Note, passphrase string) (string, error) {
+	return decryptCipher(note.Body, note.Salt, note.Nonce, passphrase)
+}
+
+// decryptRevisionBody opens a past revision's ciphertext with the salt/nonce
+// it was sealed under, which may differ from the note's current Salt/Nonce.
+func decryptRevisionBody(rev Revision, passphrase string) (string, error) {
+	return decryptCipher(rev.Body, rev.Salt, rev.Nonce, passphrase)
+}
+
+// encryptBody seals plaintext under a fresh salt+nonce, returning the
+// base64-encoded ciphertext alongside the salt and nonce to store on the Note.
+func encryptBody(passphrase, plaintext string) (body string, salt, nonce []byte, err error) {
+	salt = make([]byte, 16)
+	if _, err = rand.Read(salt); err != nil {
+		return "", nil, nil, err
+	}
+
+	key := deriveKey(passphrase, salt)
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	nonce = make([]byte, chacha20poly1305.NonceSizeX)
+	if _, err = rand.Read(nonce); err != nil {
+		return "", nil, nil, err
+	}
+
+	ciphertext := aead.Seal(nil, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(ciphertext), salt, nonce, nil
+}
+
+// renderPassphrasePrompt serves a minimal "enter passphrase" page for an
+// encrypted note; the form POSTs to /decrypt and only then renders the body.
+func renderPassphrasePrompt(w http.ResponseWriter, note Note) {
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprintf(w, `<html>
+  <head>
+    <meta name='viewport' content='width=device-width, initial-scale=1'>
+    <link rel='stylesheet' href='https://divy.work/tufte.css'>
+  </head>
+  <body>
+    <article>
+      <h1>%s</h1>
+      <p>This note is encrypted. Enter the passphrase to view it.</p>
+      <form method='POST' action='/decrypt'>
+        <input type='hidden' name='owner' value='%s'>
+        <input type='hidden' name='title' value='%s'>
+        <p><input type='password' name='passphrase' placeholder='passphrase' required autofocus></p>
+        <p><button type='submit'>Unlock</button></p>
+      </form>
+    </article>
+  </body>
+</html>`, note.Title, note.Owner, note.Title)
+	w.WriteHeader(http.StatusOK)
+}
+
+// decryptHandler serves POST /decrypt: it decrypts transiently in memory and
+// renders the plaintext through renderNoteHTML without ever persisting it.
+func decryptHandler(w http.ResponseWriter, r *http.Request) {
+	owner := r.FormValue("owner")
+	title := r.FormValue("title")
+	passphrase := r.FormValue("passphrase")
+
+	note, found := store.Get(owner, title)
+	if !found {
+		http.Error(w, "Note not found", http.StatusNotFound)
+		return
+	}
+
+	if !note.Shared {
+		requester, ok := authenticate(r)
+		if !ok || requester != owner {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	plaintext, err := decryptBody(note, passphrase)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	note.Body = plaintext
+	note.Encrypted = false
+	renderNoteHTML(w, note)
+}
+
+// lockHandler serves POST /lock?title=..., upgrading an already-synced
+// plaintext note to encrypted in place.
+func lockHandler(w http.ResponseWriter, r *http.Request) {
+	owner := r.Context().Value(ctxOwnerKey).(string)
+	title := r.URL.Query().Get("title")
+	passphrase := r.FormValue("passphrase")
+	if passphrase == "" {
+		http.Error(w, "Missing passphrase", http.StatusBadRequest)
+		return
+	}
+
+	note, ok := store.Get(owner, title)
+	if !ok {
+		http.Error(w, "Note not found", http.StatusNotFound)
+		return
+	}
+	if note.Encrypted {
+		http.Error(w, "Note is already encrypted", http.StatusBadRequest)
+		return
+	}
+
+	body, salt, nonce, err := encryptBody(passphrase, note.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	note.Body = body
+	note.Salt = salt
+	note.Nonce = nonce
+	note.Encrypted = true
+	if err := store.Put(note); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Note locked: %s", title)
+}
+
+// unlockHandler serves POST /unlock?title=..., decrypting a note in place
+// once the correct passphrase is supplied.
+func unlockHandler(w http.ResponseWriter, r *http.Request) {
+	owner := r.Context().Value(ctxOwnerKey).(string)
+	title := r.URL.Query().Get("title")
+	passphrase := r.FormValue("passphrase")
+
+	note, ok := store.Get(owner, title)
+	if !ok {
+		http.Error(w, "Note not found", http.StatusNotFound)
+		return
+	}
+	if !note.Encrypted {
+		http.Error(w, "Note is not encrypted", http.StatusBadRequest)
+		return
+	}
+
+	plaintext, err := decryptBody(note, passphrase)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	note.Body = plaintext
+	note.Salt = nil
+	note.Nonce = nil
+	note.Encrypted = false
+	if err := store.Put(note); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Note unlocked: %s", title)
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Revision is one immutable, append-only snapshot of a note's body.
+// Body is never rewritten in place; every sync and revert appends a new one.
+// Salt/Nonce pin down the exact key material an encrypted Body was sealed
+// under, since the client generates a fresh pair on every sync - without
+// them a revert can't be decrypted once the note's current Salt/Nonce moves on.
+type Revision struct {
+	ID        int       `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Author    string    `json:"author"`
+	Body      string    `json:"body"`
+	ParentID  int       `json:"parent_id"`
+	Salt      []byte    `json:"salt,omitempty"`
+	Nonce     []byte    `json:"nonce,omitempty"`
+}
+
+// newRevision builds the next revision for note, chained off its current
+// latest revision (ParentID 0 for a brand new note). salt/nonce are whatever
+// produced this particular body - nil for a plaintext revision.
+func newRevision(note Note, author, body string, salt, nonce []byte) Revision {
+	parentID := 0
+	if latest := latestRevision(note); latest != nil {
+		parentID = latest.ID
+	}
+	return Revision{
+		ID:        len(note.Revisions) + 1,
+		Timestamp: time.Now(),
+		Author:    author,
+		Body:      body,
+		ParentID:  parentID,
+		Salt:      salt,
+		Nonce:     nonce,
+	}
+}
+
+func latestRevision(note Note) *Revision {
+	if len(note.Revisions) == 0 {
+		return nil
+	}
+	return &note.Revisions[len(note.Revisions)-1]
+}
+
+func findRevision(note Note, id int) (Revision, bool) {
+	for _, rev := range note.Revisions {
+		if rev.ID == id {
+			return rev, true
+		}
+	}
+	return Revision{}, false
+}
+
+// historyHandler serves GET /history?title=... with the revision list as JSON
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+	owner := r.Context().Value(ctxOwnerKey).(string)
+	title := r.URL.Query().Get("title")
+
+	note, ok := store.Get(owner, title)
+	if !ok {
+		http.Error(w, "Note not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(note.Revisions)
+}
+
+// historyViewHandler serves GET/POST /history/view?title=...&rev=<id>,
+// rendering a past revision through the same renderNoteHTML path used for
+// the live note. An encrypted note is gated behind a passphrase prompt
+// first, same as the live view in readNoteHandler - it never renders
+// ciphertext into the editable view.
+func historyViewHandler(w http.ResponseWriter, r *http.Request) {
+	owner := r.Context().Value(ctxOwnerKey).(string)
+	title := r.URL.Query().Get("title")
+
+	id, err := strconv.Atoi(r.URL.Query().Get("rev"))
+	if err != nil {
+		http.Error(w, "Invalid rev query parameter", http.StatusBadRequest)
+		return
+	}
+
+	note, ok := store.Get(owner, title)
+	if !ok {
+		http.Error(w, "Note not found", http.StatusNotFound)
+		return
+	}
+
+	rev, ok := findRevision(note, id)
+	if !ok {
+		http.Error(w, "Revision not found", http.StatusNotFound)
+		return
+	}
+
+	if note.Encrypted {
+		passphrase := r.FormValue("passphrase")
+		if passphrase == "" {
+			renderHistoryPassphrasePrompt(w, title, fmt.Sprintf("/history/view?title=%s&rev=%d", title, id))
+			return
+		}
+
+		plaintext, err := decryptRevisionBody(rev, passphrase)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		note.Body = plaintext
+		note.Encrypted = false
+		renderNoteHTML(w, note)
+		return
+	}
+
+	note.Body = rev.Body
+	renderNoteHTML(w, note)
+}
+
+// renderHistoryPassphrasePrompt serves a minimal "enter passphrase" page for
+// viewing or diffing an encrypted note's history, POSTing back to action
+// (the same route with its query parameters preserved) with the passphrase.
+func renderHistoryPassphrasePrompt(w http.ResponseWriter, title, action string) {
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprintf(w, `<html>
+  <head>
+    <meta name='viewport' content='width=device-width, initial-scale=1'>
+    <link rel='stylesheet' href='https://divy.work/tufte.css'>
+  </head>
+  <body>
+    <article>
+      <h1>%s</h1>
+      <p>This note is encrypted. Enter the passphrase to view its history.</p>
+      <form method='POST' action='%s'>
+        <p><input type='password' name='passphrase' placeholder='passphrase' required autofocus></p>
+        <p><button type='submit'>Unlock</button></p>
+      </form>
+    </article>
+  </body>
+</html>`, title, action)
+	w.WriteHeader(http.StatusOK)
+}
+
+// historyRevertHandler serves POST /history/revert?title=...&rev=<id>,
+// creating a new revision whose body is the chosen one.
+func historyRevertHandler(w http.ResponseWriter, r *http.Request) {
+	owner := r.Context().Value(ctxOwnerKey).(string)
+	title := r.URL.Query().Get("title")
+
+	id, err := strconv.Atoi(r.URL.Query().Get("rev"))
+	if err != nil {
+		http.Error(w, "Invalid rev query parameter", http.StatusBadRequest)
+		return
+	}
+
+	note, ok := store.Get(owner, title)
+	if !ok {
+		http.Error(w, "Note not found", http.StatusNotFound)
+		return
+	}
+
+	rev, ok := findRevision(note, id)
+	if !ok {
+		http.Error(w, "Revision not found", http.StatusNotFound)
+		return
+	}
+
+	note.Revisions = append(note.Revisions, newRevision(note, owner, rev.Body, rev.Salt, rev.Nonce))
+	note.Body = rev.Body
+	note.Salt = rev.Salt
+	note.Nonce = rev.Nonce
+	note.Rev++
+	if err := store.Put(note); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Note reverted to revision %d: %s", id, title)
+}
+
+// historyDiffHandler serves GET/POST /history/diff?title=...&a=<id>&b=<id>, a
+// unified, line-based diff between two revisions rendered with <ins>/<del>.
+// An encrypted note is gated behind a passphrase prompt and both revisions
+// are decrypted with their own Salt/Nonce before diffing - the ciphertext
+// itself is never diffed or rendered.
+func historyDiffHandler(w http.ResponseWriter, r *http.Request) {
+	owner := r.Context().Value(ctxOwnerKey).(string)
+	title := r.URL.Query().Get("title")
+
+	aID, err := strconv.Atoi(r.URL.Query().Get("a"))
+	if err != nil {
+		http.Error(w, "Invalid a query parameter", http.StatusBadRequest)
+		return
+	}
+	bID, err := strconv.Atoi(r.URL.Query().Get("b"))
+	if err != nil {
+		http.Error(w, "Invalid b query parameter", http.StatusBadRequest)
+		return
+	}
+
+	note, ok := store.Get(owner, title)
+	if !ok {
+		http.Error(w, "Note not found", http.StatusNotFound)
+		return
+	}
+
+	a, ok := findRevision(note, aID)
+	if !ok {
+		http.Error(w, "Revision a not found", http.StatusNotFound)
+		return
+	}
+	b, ok := findRevision(note, bID)
+	if !ok {
+		http.Error(w, "Revision b not found", http.StatusNotFound)
+		return
+	}
+
+	aBody, bBody := a.Body, b.Body
+	if note.Encrypted {
+		passphrase := r.FormValue("passphrase")
+		if passphrase == "" {
+			renderHistoryPassphrasePrompt(w, title, fmt.Sprintf("/history/diff?title=%s&a=%d&b=%d", title, aID, bID))
+			return
+		}
+
+		var err error
+		aBody, err = decryptRevisionBody(a, passphrase)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		bBody, err = decryptRevisionBody(b, passphrase)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprintf(w, "<html><head><meta name='viewport' content='width=device-width, initial-scale=1'><link rel='stylesheet' href='https://divy.work/tufte.css'></head><body><article>")
+	fmt.Fprintf(w, "<h2>%s: rev %d &rarr; rev %d</h2>", title, aID, bID)
+	fmt.Fprintf(w, "<pre>%s</pre>", unifiedDiffHTML(aBody, bBody))
+	fmt.Fprintf(w, "</article></body></html>")
+	w.WriteHeader(http.StatusOK)
+}
+
+// diffOp is one line of an LCS-aligned edit script.
+type diffOp struct {
+	kind int // 0 = equal, 1 = delete (from a), 2 = insert (from b)
+	line string
+}
+
+const (
+	diffEqual = iota
+	diffDelete
+	diffInsert
+)
+
+// lcsDiff runs an O(n*m) DP over rune lines and returns the aligned edit
+// script (equal/delete/insert) between a and b.
+func lcsDiff(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	dp := make([][]int, n+1)
+	for i := range dp {
+		dp[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				dp[i][j] = dp[i+1][j+1] + 1
+			} else if dp[i+1][j] >= dp[i][j+1] {
+				dp[i][j] = dp[i+1][j]
+			} else {
+				dp[i][j] = dp[i][j+1]
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{diffEqual, a[i]})
+			i++
+			j++
+		case dp[i+1][j] >= dp[i][j+1]:
+			ops = append(ops, diffOp{diffDelete, a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{diffInsert, b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		ops = append(ops, diffOp{diffDelete, a[i]})
+	}
+	for ; j < m; j++ {
+		ops = append(ops, diffOp{diffInsert, b[j]})
+	}
+	return ops
+}
+
+// unifiedDiffHTML renders the LCS edit script as `@@` hunks with 3 lines of
+// context, marking changed lines with <ins>/<del> spans.
+func unifiedDiffHTML(a, b string) string {
+	ops := lcsDiff(strings.Split(a, "\n"), strings.Split(b, "\n"))
+
+	const context = 3
+	var hunks [][]diffOp
+	var cur []diffOp
+	var pending []diffOp // up to context equal lines seen while no hunk is open
+	unchangedRun := 0
+
+	flush := func() {
+		if len(cur) > 0 {
+			hunks = append(hunks, cur)
+			cur = nil
+		}
+	}
+
+	for _, op := range ops {
+		if op.kind == diffEqual {
+			unchangedRun++
+			if len(cur) == 0 {
+				pending = append(pending, op)
+				if len(pending) > context {
+					pending = pending[1:]
+				}
+				continue
+			}
+			cur = append(cur, op)
+			if unchangedRun > context {
+				// close the hunk after its trailing context; the line past it
+				// starts the leading context of the next hunk
+				cur = cur[:len(cur)-1]
+				flush()
+				pending = []diffOp{op}
+			}
+			continue
+		}
+
+		unchangedRun = 0
+		cur = append(cur, pending...)
+		pending = nil
+		cur = append(cur, op)
+	}
+	flush()
+
+	var out strings.Builder
+	for _, hunk := range hunks {
+		fmt.Fprintf(&out, "@@\n")
+		for _, op := range hunk {
+			switch op.kind {
+			case diffEqual:
+				fmt.Fprintf(&out, "  %s\n", op.line)
+			case diffDelete:
+				fmt.Fprintf(&out, "<del>- %s</del>\n", op.line)
+			case diffInsert:
+				fmt.Fprintf(&out, "<ins>+ %s</ins>\n", op.line)
+			}
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// delta is one live edit broadcast to every other subscriber of a note.
+type delta struct {
+	Op       string `json:"op"` // "replace", "insert" or "delete"
+	Pos      int    `json:"pos"`
+	Text     string `json:"text"`
+	ClientID string `json:"clientId"`
+	Rev      int    `json:"rev"`
+}
+
+// wsClient is a single subscriber connection registered with a hub.
+// canWrite is false for a viewer of someone else's shared note: it still
+// receives broadcast deltas, but anything it sends is dropped rather than
+// applied - "shared" only ever meant publicly readable, not writable.
+type wsClient struct {
+	conn     *websocket.Conn
+	send     chan delta
+	canWrite bool
+}
+
+// hub fans deltas out to every other subscriber of one (owner, title) note and
+// debounces persistence so rapid keystrokes don't hit disk/store on every
+// message - it keeps its own in-memory copy of the note, mutated per delta,
+// and only calls store.Put once the edits settle.
+type hub struct {
+	owner, title string
+
+	register   chan *wsClient
+	unregister chan *wsClient
+	broadcast  chan deltaFromClient
+
+	mu      sync.Mutex
+	clients map[*wsClient]bool
+
+	current Note
+}
+
+type deltaFromClient struct {
+	from *wsClient
+	d    delta
+}
+
+var (
+	hubs     = map[string]*hub{}
+	hubsLock sync.Mutex
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	CheckOrigin:     checkWSOrigin,
+}
+
+// checkWSOrigin rejects cross-site WebSocket handshakes. Browsers attach the
+// session cookie to a /ws/ upgrade regardless of origin, so without this any
+// external site could open a socket riding a logged-in victim's cookie
+// (cross-site WebSocket hijacking). Non-browser clients that send no Origin
+// header at all (curl, the CLI) are let through.
+func checkWSOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// getHub returns the hub for (owner, title), starting its run loop the
+// first time it's requested.
+func getHub(owner, title string) *hub {
+	key := owner + "/" + title
+
+	hubsLock.Lock()
+	defer hubsLock.Unlock()
+
+	h, ok := hubs[key]
+	if !ok {
+		note, _ := store.Get(owner, title)
+		h = &hub{
+			owner:      owner,
+			title:      title,
+			register:   make(chan *wsClient),
+			unregister: make(chan *wsClient),
+			broadcast:  make(chan deltaFromClient),
+			clients:    map[*wsClient]bool{},
+			current:    note,
+		}
+		hubs[key] = h
+		go h.run()
+	}
+	return h
+}
+
+// run is the hub's event loop: register/unregister clients, fan out deltas,
+// and persist to the store 2s after the last delta settles.
+func (h *hub) run() {
+	var debounce *time.Timer
+
+	persist := func() {
+		h.mu.Lock()
+		note := h.current
+		h.mu.Unlock()
+		store.Put(note)
+	}
+
+	for {
+		select {
+		case c := <-h.register:
+			h.mu.Lock()
+			h.clients[c] = true
+			h.mu.Unlock()
+
+		case c := <-h.unregister:
+			h.mu.Lock()
+			if _, ok := h.clients[c]; ok {
+				delete(h.clients, c)
+				close(c.send)
+			}
+			h.mu.Unlock()
+
+		case m := <-h.broadcast:
+			h.mu.Lock()
+			h.current.Body = applyDelta(h.current.Body, m.d)
+			h.current.Rev++
+			for c := range h.clients {
+				if c == m.from {
+					continue
+				}
+				select {
+				case c.send <- m.d:
+				default:
+				}
+			}
+			h.mu.Unlock()
+
+			if debounce != nil {
+				debounce.Stop()
+			}
+			debounce = time.AfterFunc(2*time.Second, persist)
+		}
+	}
+}
+
+// snapshot returns the hub's current in-memory note state, which may be
+// ahead of what's on store if edits are still sitting in the debounce window.
+func (h *hub) snapshot() Note {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.current
+}
+
+// applyDelta patches body with a single op message.
+func applyDelta(body string, d delta) string {
+	switch d.Op {
+	case "insert":
+		if d.Pos < 0 || d.Pos > len(body) {
+			return body
+		}
+		return body[:d.Pos] + d.Text + body[d.Pos:]
+	case "delete":
+		end := d.Pos + len(d.Text)
+		if d.Pos < 0 || end > len(body) {
+			return body
+		}
+		return body[:d.Pos] + body[end:]
+	case "replace":
+		return d.Text
+	default:
+		return body
+	}
+}
+
+// wsHandler upgrades GET /ws/<owner>/<title>, behind the same auth as
+// authMiddleware (session/Basic), or read-only for anyone on a shared note,
+// sends the hub's current body, then streams/receives delta messages for
+// the lifetime of the connection.
+func wsHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/ws/")
+	parts := strings.SplitN(path, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		http.Error(w, "Missing owner/title path", http.StatusBadRequest)
+		return
+	}
+	owner, title := parts[0], parts[1]
+
+	note, ok := store.Get(owner, title)
+	if !ok {
+		http.Error(w, "Note not found", http.StatusNotFound)
+		return
+	}
+
+	requester, authed := authenticate(r)
+	isOwner := authed && requester == owner
+
+	if !note.Shared && !isOwner {
+		w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println("Error upgrading websocket:", err)
+		return
+	}
+
+	h := getHub(owner, title)
+	c := &wsClient{conn: conn, send: make(chan delta, 16), canWrite: isOwner}
+	h.register <- c
+
+	// Read back from the hub, not the store lookup above: a second tab
+	// joining an already-active session must see in-flight edits that
+	// haven't hit the debounced persist yet.
+	current := h.snapshot()
+	conn.WriteJSON(delta{Op: "replace", Pos: 0, Text: current.Body, Rev: current.Rev})
+
+	go c.writePump()
+	c.readPump(h)
+}
+
+func (c *wsClient) writePump() {
+	for d := range c.send {
+		if err := c.conn.WriteJSON(d); err != nil {
+			return
+		}
+	}
+}
+
+func (c *wsClient) readPump(h *hub) {
+	defer func() {
+		h.unregister <- c
+		c.conn.Close()
+	}()
+
+	for {
+		var d delta
+		if err := c.conn.ReadJSON(&d); err != nil {
+			return
+		}
+		if !c.canWrite {
+			continue
+		}
+		h.broadcast <- deltaFromClient{from: c, d: d}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// jsonStore is the original persistence model: the whole note set rewritten
+// to a single JSON file on every write. Kept for backward compatibility.
+type jsonStore struct {
+	mu    sync.Mutex
+	path  string
+	notes []Note
+}
+
+func newJSONStore(path string) *jsonStore {
+	s := &jsonStore{path: path}
+	s.load()
+	return s
+}
+
+func (s *jsonStore) load() {
+	file, err := os.Open(s.path)
+	if err != nil {
+		fmt.Println("No existing notes found, starting fresh.")
+		os.MkdirAll(filepath.Dir(s.path), os.ModePerm)
+		return
+	}
+	defer file.Close()
+
+	if err := json.NewDecoder(file).Decode(&s.notes); err != nil {
+		log.Fatal("Error decoding notes:", err)
+	}
+	fmt.Println("Notes loaded successfully.")
+}
+
+func (s *jsonStore) save() {
+	file, err := os.Create(s.path)
+	if err != nil {
+		log.Fatal("Error creating file:", err)
+	}
+	defer file.Close()
+
+	if err := json.NewEncoder(file).Encode(s.notes); err != nil {
+		log.Fatal("Error encoding notes:", err)
+	}
+}
+
+func (s *jsonStore) Get(owner, title string) (Note, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, n := range s.notes {
+		if n.Owner == owner && n.Title == title {
+			return n, true
+		}
+	}
+	return Note{}, false
+}
+
+func (s *jsonStore) Put(note Note) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, n := range s.notes {
+		if n.Owner == note.Owner && n.Title == note.Title {
+			s.notes[i] = note
+			s.save()
+			return nil
+		}
+	}
+	s.notes = append(s.notes, note)
+	s.save()
+	return nil
+}
+
+func (s *jsonStore) Delete(owner, title string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, n := range s.notes {
+		if n.Owner == owner && n.Title == title {
+			s.notes = append(s.notes[:i], s.notes[i+1:]...)
+			s.save()
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s *jsonStore) List(owner string) ([]Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if owner == "" {
+		out := make([]Note, len(s.notes))
+		copy(out, s.notes)
+		return out, nil
+	}
+
+	var out []Note
+	for _, n := range s.notes {
+		if n.Owner == owner {
+			out = append(out, n)
+		}
+	}
+	return out, nil
+}
+
+func (s *jsonStore) SetShared(owner, title string, shared bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, n := range s.notes {
+		if n.Owner == owner && n.Title == title {
+			s.notes[i].Shared = shared
+			s.save()
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+)
+
+// runMigrate implements `livenote migrate`: it reads the legacy notes.json
+// and inserts every row into the configured store inside a single transaction.
+// STORAGE_PATH names the destination sqlite file; the legacy file is always
+// read from the hardcoded JSON path since that's what STORAGE=json predates.
+func runMigrate() {
+	legacyPath := filename
+
+	file, err := os.Open(legacyPath)
+	if err != nil {
+		log.Fatal("Error opening legacy notes file:", err)
+	}
+	defer file.Close()
+
+	var legacy []Note
+	if err := json.NewDecoder(file).Decode(&legacy); err != nil {
+		log.Fatal("Error decoding legacy notes file:", err)
+	}
+
+	dest := storagePathEnv
+	if dest == "" {
+		log.Fatal("STORAGE_PATH must be set to the destination sqlite file")
+	}
+
+	s, err := newSQLiteStore(dest)
+	if err != nil {
+		log.Fatal("Error opening destination store:", err)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Fatal("Error starting migration transaction:", err)
+	}
+
+	for _, note := range legacy {
+		shared, encrypted := 0, 0
+		if note.Shared {
+			shared = 1
+		}
+		if note.Encrypted {
+			encrypted = 1
+		}
+		if _, err := tx.Exec(`INSERT INTO notes (owner, title, body, shared, rev, encrypted, salt, nonce, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, strftime('%s','now'))
+			ON CONFLICT(owner, title) DO UPDATE SET
+				body = excluded.body, shared = excluded.shared, rev = excluded.rev,
+				encrypted = excluded.encrypted, salt = excluded.salt, nonce = excluded.nonce`,
+			note.Owner, note.Title, note.Body, shared, note.Rev, encrypted, note.Salt, note.Nonce); err != nil {
+			tx.Rollback()
+			log.Fatal("Error migrating note:", note.Title, err)
+		}
+		for _, rev := range note.Revisions {
+			if _, err := tx.Exec(`INSERT OR IGNORE INTO revisions (owner, title, id, timestamp, author, body, parent_id, salt, nonce)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				note.Owner, note.Title, rev.ID, rev.Timestamp.Unix(), rev.Author, rev.Body, rev.ParentID, rev.Salt, rev.Nonce); err != nil {
+				tx.Rollback()
+				log.Fatal("Error migrating revision for note:", note.Title, err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Fatal("Error committing migration:", err)
+	}
+
+	fmt.Printf("Migrated %d notes from %s to %s\n", len(legacy), legacyPath, dest)
+}
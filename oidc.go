@@ -0,0 +1,318 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// oidcConfig holds the operator-supplied IdP settings, read purely from .env
+type oidcConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+}
+
+// oidcDiscovery mirrors the subset of /.well-known/openid-configuration we use
+type oidcDiscovery struct {
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	EndSessionEndpoint    string `json:"end_session_endpoint"`
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+const oidcStateCookieName = "livenote_oidc_state"
+
+var (
+	oidcCfg  oidcConfig
+	oidcDisc oidcDiscovery
+	oidcKeys = map[string]*rsa.PublicKey{}
+)
+
+// initOIDC reads OIDC_* env vars and, if configured, fetches the discovery
+// document and JWKS so the authorization/token/logout endpoints are ready.
+func initOIDC() {
+	oidcCfg = oidcConfig{
+		Issuer:       os.Getenv("OIDC_ISSUER"),
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+	}
+
+	if oidcCfg.Issuer == "" {
+		return
+	}
+
+	resp, err := http.Get(strings.TrimSuffix(oidcCfg.Issuer, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		log.Fatal("Error fetching OIDC discovery document:", err)
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(&oidcDisc); err != nil {
+		log.Fatal("Error decoding OIDC discovery document:", err)
+	}
+
+	if err := loadJWKS(); err != nil {
+		log.Fatal("Error loading OIDC JWKS:", err)
+	}
+
+	fmt.Println("OIDC configured against", oidcCfg.Issuer)
+}
+
+func loadJWKS() error {
+	resp, err := http.Get(oidcDisc.JWKSURI)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return err
+	}
+
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		nBytes, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		eBytes, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+		e := 0
+		for _, b := range eBytes {
+			e = e<<8 | int(b)
+		}
+		oidcKeys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(nBytes), E: e}
+	}
+	return nil
+}
+
+// oidcLoginHandler generates state+nonce, stores them in a session cookie
+// and redirects to the authorization endpoint.
+func oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	state := newToken()
+	nonce := newToken()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookieName,
+		Value:    state + ":" + nonce,
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   300,
+	})
+
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("scope", "openid profile email")
+	q.Set("client_id", oidcCfg.ClientID)
+	q.Set("redirect_uri", oidcCfg.RedirectURL)
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+
+	http.Redirect(w, r, oidcDisc.AuthorizationEndpoint+"?"+q.Encode(), http.StatusFound)
+}
+
+// oidcCallbackHandler exchanges the code, validates the ID token, and binds
+// the `sub` claim to a local user record before starting a session.
+func oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(oidcStateCookieName)
+	if err != nil {
+		http.Error(w, "Missing OIDC state cookie", http.StatusBadRequest)
+		return
+	}
+	parts := strings.SplitN(cookie.Value, ":", 2)
+	if len(parts) != 2 {
+		http.Error(w, "Malformed OIDC state cookie", http.StatusBadRequest)
+		return
+	}
+	wantState, wantNonce := parts[0], parts[1]
+
+	if r.URL.Query().Get("state") != wantState {
+		http.Error(w, "State mismatch", http.StatusBadRequest)
+		return
+	}
+
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		http.Error(w, "Missing code", http.StatusBadRequest)
+		return
+	}
+
+	idToken, err := exchangeCode(code)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	claims, err := verifyIDToken(idToken, wantNonce)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	user := bindOIDCUser(claims.Subject, claims.Email)
+
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookieName, Value: "", Path: "/", MaxAge: -1})
+	startSession(w, user.Username)
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// oidcLogoutHandler tears down the local session and, if the IdP supports
+// it, redirects through end_session_endpoint.
+func oidcLogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		sessionsLock.Lock()
+		delete(sessions, cookie.Value)
+		sessionsLock.Unlock()
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookieName, Value: "", Path: "/", MaxAge: -1})
+
+	if oidcDisc.EndSessionEndpoint == "" {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+
+	q := url.Values{}
+	q.Set("client_id", oidcCfg.ClientID)
+	q.Set("post_logout_redirect_uri", oidcCfg.RedirectURL)
+	http.Redirect(w, r, oidcDisc.EndSessionEndpoint+"?"+q.Encode(), http.StatusFound)
+}
+
+func exchangeCode(code string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", oidcCfg.RedirectURL)
+	form.Set("client_id", oidcCfg.ClientID)
+	form.Set("client_secret", oidcCfg.ClientSecret)
+
+	resp, err := http.PostForm(oidcDisc.TokenEndpoint, form)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var tokenResp struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return "", err
+	}
+	if tokenResp.IDToken == "" {
+		return "", errors.New("token response did not include an id_token")
+	}
+	return tokenResp.IDToken, nil
+}
+
+type idTokenClaims struct {
+	Subject string      `json:"sub"`
+	Email   string      `json:"email"`
+	Issuer  string      `json:"iss"`
+	Nonce   string      `json:"nonce"`
+	Exp     int64       `json:"exp"`
+	Aud     interface{} `json:"aud"`
+}
+
+// verifyIDToken checks the RS256 signature against the cached JWKS, then
+// validates nonce, iss, aud and exp as required by the OIDC core spec.
+func verifyIDToken(token, wantNonce string) (*idTokenClaims, error) {
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		return nil, errors.New("malformed ID token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	headerJSON, err := base64.RawURLEncoding.DecodeString(segments[0])
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, err
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("unsupported ID token alg: %s", header.Alg)
+	}
+
+	key, ok := oidcKeys[header.Kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key: %s", header.Kid)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(segments[2])
+	if err != nil {
+		return nil, err
+	}
+	signed := segments[0] + "." + segments[1]
+	digest := sha256.Sum256([]byte(signed))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+		return nil, fmt.Errorf("ID token signature invalid: %w", err)
+	}
+
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(segments[1])
+	if err != nil {
+		return nil, err
+	}
+	var claims idTokenClaims
+	if err := json.Unmarshal(claimsJSON, &claims); err != nil {
+		return nil, err
+	}
+
+	if claims.Nonce != wantNonce {
+		return nil, errors.New("nonce mismatch")
+	}
+	if claims.Issuer != oidcCfg.Issuer && claims.Issuer != strings.TrimSuffix(oidcCfg.Issuer, "/") {
+		return nil, errors.New("unexpected issuer")
+	}
+	if !audienceContains(claims.Aud, oidcCfg.ClientID) {
+		return nil, errors.New("unexpected audience")
+	}
+	if time.Now().Unix() > claims.Exp {
+		return nil, errors.New("ID token expired")
+	}
+
+	return &claims, nil
+}
+
+func audienceContains(aud interface{}, clientID string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == clientID
+	case []interface{}:
+		for _, a := range v {
+			if s, ok := a.(string); ok && s == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
 	"crypto/subtle"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -11,6 +14,7 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/joho/godotenv"
 	"golang.org/x/crypto/bcrypt"
@@ -18,15 +22,53 @@ import (
 
 // Note struct represents a note
 type Note struct {
-	Title  string `json:"title"`
-	Body   string `json:"body"`
-	Shared bool   `json:"shared"`
+	Owner     string     `json:"owner"`
+	Title     string     `json:"title"`
+	Body      string     `json:"body"`
+	Shared    bool       `json:"shared"`
+	Rev       int        `json:"rev"`
+	Revisions []Revision `json:"revisions,omitempty"`
+	Encrypted bool       `json:"encrypted,omitempty"`
+	Salt      []byte     `json:"salt,omitempty"`
+	Nonce     []byte     `json:"nonce,omitempty"`
 }
 
+// User struct represents a registered account
+type User struct {
+	Username     string    `json:"username"`
+	PasswordHash []byte    `json:"password_hash"`
+	OIDCSubject  string    `json:"oidc_subject,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// session is the server-side record behind a random session-token cookie
+type session struct {
+	Username  string
+	Expiry    time.Time
+	CSRFToken string
+}
+
+const sessionCookieName = "livenote_session"
+const nonceCookieName = "livenote_nonce"
+const csrfCookieName = "livenote_csrf"
+const sessionTTL = 30 * 24 * time.Hour
+
 var (
-	notes        []Note
-	notesLock    sync.Mutex
-	filename     = "/var/notes/notes.json"
+	filename = "/var/notes/notes.json"
+
+	store Store
+
+	storageKindEnv string
+	storagePathEnv string
+
+	users     []User
+	usersLock sync.Mutex
+	usersFile = "/var/notes/users.json"
+
+	sessions     = map[string]session{}
+	sessionsLock sync.Mutex
+
+	// legacy single-user Basic auth credentials, kept for backward compatibility
 	username     string
 	passwordHash []byte
 )
@@ -37,60 +79,150 @@ func main() {
 		// pass
 	}
 
+	storageKindEnv = os.Getenv("STORAGE")
+	storagePathEnv = os.Getenv("STORAGE_PATH")
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate()
+		return
+	}
+
 	username = os.Getenv("USERNAME")
-	password := os.Getenv("PASSWORD")
-	passwordHash, err = bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		log.Fatal("Error generating password hash:", err)
+	if password := os.Getenv("PASSWORD"); password != "" {
+		passwordHash, err = bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			log.Fatal("Error generating password hash:", err)
+		}
 	}
 
-	loadNotes()
+	store = openStore()
+
+	loadUsers()
+	initOIDC()
 
 	http.HandleFunc("/", homeHandler)
-	http.HandleFunc("/sync", authMiddleware(syncNoteRawHandler, username, passwordHash))
-	http.HandleFunc("/delete", authMiddleware(deleteNoteHandler, username, passwordHash))
-	http.HandleFunc("/share", authMiddleware(shareNoteHandler, username, passwordHash))
+	http.HandleFunc("/register", registerHandler)
+	http.HandleFunc("/login", loginHandler)
+	http.HandleFunc("/logout", logoutHandler)
+	http.HandleFunc("/sync", authMiddleware(requireMethod(http.MethodPost, requireCSRF(syncNoteRawHandler))))
+	http.HandleFunc("/delete", authMiddleware(requireMethod(http.MethodPost, requireCSRF(deleteNoteHandler))))
+	http.HandleFunc("/share", authMiddleware(requireMethod(http.MethodPost, requireCSRF(shareNoteHandler))))
+	http.HandleFunc("/history", authMiddleware(historyHandler))
+	http.HandleFunc("/history/view", authMiddleware(historyViewHandler))
+	http.HandleFunc("/history/revert", authMiddleware(requireMethod(http.MethodPost, requireCSRF(historyRevertHandler))))
+	http.HandleFunc("/history/diff", authMiddleware(historyDiffHandler))
+	http.HandleFunc("/ws/", wsHandler)
+	http.HandleFunc("/decrypt", decryptHandler)
+	http.HandleFunc("/lock", authMiddleware(requireMethod(http.MethodPost, requireCSRF(lockHandler))))
+	http.HandleFunc("/unlock", authMiddleware(requireMethod(http.MethodPost, requireCSRF(unlockHandler))))
 	http.HandleFunc("/x/", readNoteHandler)
 
+	if oidcCfg.Issuer != "" {
+		http.HandleFunc("/oidc/login", oidcLoginHandler)
+		http.HandleFunc("/oidc/callback", oidcCallbackHandler)
+		http.HandleFunc("/oidc/logout", oidcLogoutHandler)
+	}
+
 	fmt.Println("Server is running on http://localhost:8080")
 	log.Fatal(http.ListenAndServe(":8080", nil))
 }
 
-// Load notes from file
-func loadNotes() {
-	file, err := os.Open(filename)
+// Load users from file
+func loadUsers() {
+	file, err := os.Open(usersFile)
 	defer file.Close()
 	if err != nil {
-		fmt.Println("No existing notes found, starting fresh.")
+		fmt.Println("No existing users found, starting fresh.")
 		os.MkdirAll("/var/notes", os.ModePerm)
 		return
 	}
 
 	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&notes); err != nil {
-		log.Fatal("Error decoding notes:", err)
+	if err := decoder.Decode(&users); err != nil {
+		log.Fatal("Error decoding users:", err)
 	}
-	fmt.Println("Notes loaded successfully.")
+	fmt.Println("Users loaded successfully.")
 }
 
-// Save notes to file
-func saveNotes() {
-	file, err := os.Create(filename)
+// Save users to file
+func saveUsers() {
+	file, err := os.Create(usersFile)
 	defer file.Close()
 	if err != nil {
 		log.Fatal("Error creating file:", err)
 	}
 
 	encoder := json.NewEncoder(file)
-	if err := encoder.Encode(notes); err != nil {
-		log.Fatal("Error encoding notes:", err)
+	if err := encoder.Encode(users); err != nil {
+		log.Fatal("Error encoding users:", err)
+	}
+}
+
+func findUser(name string) (User, bool) {
+	usersLock.Lock()
+	defer usersLock.Unlock()
+
+	for _, u := range users {
+		if u.Username == name {
+			return u, true
+		}
+	}
+	return User{}, false
+}
+
+// findUserBySubject looks up the local account bound to an OIDC `sub` claim
+func findUserBySubject(sub string) (User, bool) {
+	usersLock.Lock()
+	defer usersLock.Unlock()
+
+	for _, u := range users {
+		if u.OIDCSubject != "" && u.OIDCSubject == sub {
+			return u, true
+		}
 	}
+	return User{}, false
+}
+
+// bindOIDCUser finds or creates the local account for an authenticated
+// OIDC subject, naming new accounts after the email claim (falling back to
+// the subject) since there is no password to pick a username at register time.
+func bindOIDCUser(sub, email string) User {
+	if u, ok := findUserBySubject(sub); ok {
+		return u
+	}
+
+	name := email
+	if name == "" {
+		name = sub
+	}
+
+	usersLock.Lock()
+	defer usersLock.Unlock()
+	for _, u := range users {
+		if u.Username == name {
+			name = name + "-" + sub
+			break
+		}
+	}
+
+	u := User{Username: name, OIDCSubject: sub, CreatedAt: time.Now()}
+	users = append(users, u)
+	saveUsers()
+	return u
+}
+
+// newToken returns a random, URL-safe session/nonce token
+func newToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatal("Error generating token:", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
 }
 
 // Handler for the home page
 func homeHandler(w http.ResponseWriter, r *http.Request) {
-	notesLock.Lock()
-	defer notesLock.Unlock()
+	allNotes, _ := store.List("")
 
 	fmt.Fprintf(w, "<html><head><meta name='viewport' content='width=device-width, initial-scale=1'><link rel='stylesheet' href='https://divy.work/tufte.css'></head><body><article>")
 
@@ -99,17 +231,11 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
 
 	fmt.Fprintf(w, "<pre><code>")
 	fmt.Fprintf(w, "<p>Instance host: %s</p>", r.Host)
-	fmt.Fprintf(w, "<p>Notes: %d</p>", len(notes))
-	file, err := os.Open(filename)
-	defer file.Close()
-	if err != nil {
-		fmt.Fprintf(w, "<p>Storage not available</p>")
-	} else {
-		fi, _ := file.Stat()
-		fmt.Fprintf(w, "<p>Space used: %d KB / %d KB</p>", fi.Size()/1024, 2*1024*1024)
-	}
+	fmt.Fprintf(w, "<p>Notes: %d</p>", len(allNotes))
 	fmt.Fprintf(w, "</code></pre>")
 
+	fmt.Fprintf(w, "<p><a href='/login'>Log in</a> or <a href='/register'>register</a></p>")
+
 	fmt.Fprintf(w, "<footer><p><a href='https://github.com/littledivy/livenote'>Host your own</a></a></p></footer>")
 
 	fmt.Fprintf(w, "</article></body></html>")
@@ -117,10 +243,201 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// loginTpl renders the login/register form, mirroring listmonk's login flow:
+// a GET renders the form with the `next` redirect target and a nonce cookie,
+// a POST validates credentials and 302s to `next`.
+func loginTpl(w http.ResponseWriter, next, action, heading, errMsg string) {
+	nonce := newToken()
+	http.SetCookie(w, &http.Cookie{
+		Name:     nonceCookieName,
+		Value:    nonce,
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   300,
+	})
+
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprintf(w, `<html><head><meta name='viewport' content='width=device-width, initial-scale=1'><link rel='stylesheet' href='https://divy.work/tufte.css'></head><body><article>`)
+	fmt.Fprintf(w, "<h2>%s</h2>", heading)
+	if errMsg != "" {
+		fmt.Fprintf(w, "<p style='color:red'>%s</p>", errMsg)
+	}
+	fmt.Fprintf(w, `<form method='POST' action='%s'>
+		<input type='hidden' name='next' value='%s'>
+		<input type='hidden' name='nonce' value='%s'>
+		<p><input type='text' name='username' placeholder='username' required></p>
+		<p><input type='password' name='password' placeholder='password' required></p>
+		<p><button type='submit'>%s</button></p>
+	</form>`, action, next, nonce, heading)
+	fmt.Fprintf(w, `</article></body></html>`)
+	w.WriteHeader(http.StatusOK)
+}
+
+// nextOrDefault reads the post-login redirect target, falling back to "/"
+// for anything that isn't a same-site path - a bare "/foo" is fine, but
+// "//evil.example", "/\evil.example" and absolute/scheme-relative URLs are
+// all ways browsers will happily follow off-site, so they're rejected rather
+// than handed to http.Redirect.
+func nextOrDefault(r *http.Request) string {
+	next := r.URL.Query().Get("next")
+	if next == "" {
+		next = r.FormValue("next")
+	}
+	if !isLocalRedirect(next) {
+		return "/"
+	}
+	return next
+}
+
+func isLocalRedirect(next string) bool {
+	if next == "" || next[0] != '/' {
+		return false
+	}
+	if len(next) > 1 && (next[1] == '/' || next[1] == '\\') {
+		return false
+	}
+	return true
+}
+
+// registerHandler creates a new account with a bcrypt-hashed password
+func registerHandler(w http.ResponseWriter, r *http.Request) {
+	next := nextOrDefault(r)
+
+	if r.Method == http.MethodGet {
+		loginTpl(w, next, "/register", "Register", "")
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	nonceCookie, err := r.Cookie(nonceCookieName)
+	if err != nil || nonceCookie.Value != r.FormValue("nonce") {
+		loginTpl(w, next, "/register", "Register", "Form expired, try again")
+		return
+	}
+
+	name := r.FormValue("username")
+	pass := r.FormValue("password")
+	if name == "" || pass == "" {
+		loginTpl(w, next, "/register", "Register", "Username and password are required")
+		return
+	}
+
+	if _, ok := findUser(name); ok {
+		loginTpl(w, next, "/register", "Register", "Username already taken")
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(pass), bcrypt.DefaultCost)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	usersLock.Lock()
+	users = append(users, User{Username: name, PasswordHash: hash, CreatedAt: time.Now()})
+	saveUsers()
+	usersLock.Unlock()
+
+	startSession(w, name)
+	http.Redirect(w, r, next, http.StatusFound)
+}
+
+// loginHandler authenticates a registered user and issues a session cookie
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+	next := nextOrDefault(r)
+
+	if r.Method == http.MethodGet {
+		loginTpl(w, next, "/login", "Log in", "")
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	nonceCookie, err := r.Cookie(nonceCookieName)
+	if err != nil || nonceCookie.Value != r.FormValue("nonce") {
+		loginTpl(w, next, "/login", "Log in", "Form expired, try again")
+		return
+	}
+
+	name := r.FormValue("username")
+	pass := r.FormValue("password")
+
+	user, ok := findUser(name)
+	if !ok || !checkPassword(pass, user.PasswordHash) {
+		loginTpl(w, next, "/login", "Log in", "Invalid username or password")
+		return
+	}
+
+	startSession(w, name)
+	http.Redirect(w, r, next, http.StatusFound)
+}
+
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		sessionsLock.Lock()
+		delete(sessions, cookie.Value)
+		sessionsLock.Unlock()
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: sessionCookieName, Value: "", Path: "/", MaxAge: -1})
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// startSession creates a random session-token cookie backed by a server-side record,
+// plus a sibling CSRF cookie the note-editing UI echoes back as the
+// X-CSRF-Token header on state-changing requests (requireCSRF below) - the
+// same double-submit defense loginTpl's nonce gives the login/register forms.
+func startSession(w http.ResponseWriter, name string) {
+	token := newToken()
+	csrfToken := newToken()
+
+	sessionsLock.Lock()
+	sessions[token] = session{Username: name, Expiry: time.Now().Add(sessionTTL), CSRFToken: csrfToken}
+	sessionsLock.Unlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   int(sessionTTL.Seconds()),
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:   csrfCookieName,
+		Value:  csrfToken,
+		Path:   "/",
+		MaxAge: int(sessionTTL.Seconds()),
+	})
+}
+
+// userFromSession returns the username bound to a valid, unexpired session cookie
+func userFromSession(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return "", false
+	}
+
+	sessionsLock.Lock()
+	defer sessionsLock.Unlock()
+
+	s, ok := sessions[cookie.Value]
+	if !ok || time.Now().After(s.Expiry) {
+		delete(sessions, cookie.Value)
+		return "", false
+	}
+	return s.Username, true
+}
+
 // Handler for sharing a note
 func shareNoteHandler(w http.ResponseWriter, r *http.Request) {
-	notesLock.Lock()
-	defer notesLock.Unlock()
+	owner := r.Context().Value(ctxOwnerKey).(string)
 
 	title := r.URL.Query().Get("title")
 	if title == "" {
@@ -128,21 +445,15 @@ func shareNoteHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var shared bool
-	for i, note := range notes {
-		if note.Title == title {
-			notes[i].Shared = true
-			shared = true
-			break
-		}
-	}
-
-	if !shared {
+	if _, ok := store.Get(owner, title); !ok {
 		http.Error(w, "Note not found", http.StatusNotFound)
 		return
 	}
 
-	saveNotes()
+	if err := store.SetShared(owner, title, true); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintf(w, "Note shared: %s", title)
@@ -150,8 +461,7 @@ func shareNoteHandler(w http.ResponseWriter, r *http.Request) {
 
 // Handler to delete a note
 func deleteNoteHandler(w http.ResponseWriter, r *http.Request) {
-	notesLock.Lock()
-	defer notesLock.Unlock()
+	owner := r.Context().Value(ctxOwnerKey).(string)
 
 	title := r.URL.Query().Get("title")
 	if title == "" {
@@ -159,21 +469,15 @@ func deleteNoteHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var deleted bool
-	for i, note := range notes {
-		if note.Title == title {
-			notes = append(notes[:i], notes[i+1:]...)
-			deleted = true
-			break
-		}
-	}
-
-	if !deleted {
+	if _, ok := store.Get(owner, title); !ok {
 		http.Error(w, "Note not found", http.StatusNotFound)
 		return
 	}
 
-	saveNotes()
+	if err := store.Delete(owner, title); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintf(w, "Note deleted: %s", title)
@@ -181,8 +485,7 @@ func deleteNoteHandler(w http.ResponseWriter, r *http.Request) {
 
 // Handler to add or update a note
 func syncNoteRawHandler(w http.ResponseWriter, r *http.Request) {
-	notesLock.Lock()
-	defer notesLock.Unlock()
+	owner := r.Context().Value(ctxOwnerKey).(string)
 
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
@@ -196,65 +499,61 @@ func syncNoteRawHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if the note already exists
-	var exists bool
-	for i, note := range notes {
-		if note.Title == updatedNote.Title {
-			notes[i].Body = updatedNote.Body
-			exists = true
-			break
-		}
+	// The body is stored verbatim (ciphertext and all) - an encrypted note
+	// is never markdown-rendered.
+	note, exists := store.Get(owner, updatedNote.Title)
+	if exists {
+		note.Revisions = append(note.Revisions, newRevision(note, owner, updatedNote.Body, updatedNote.Salt, updatedNote.Nonce))
+		note.Rev++
+	} else {
+		note = Note{Owner: owner, Title: updatedNote.Title, Shared: false}
+		note.Revisions = append(note.Revisions, newRevision(note, owner, updatedNote.Body, updatedNote.Salt, updatedNote.Nonce))
 	}
+	note.Body = updatedNote.Body
+	note.Encrypted = updatedNote.Encrypted
+	note.Salt = updatedNote.Salt
+	note.Nonce = updatedNote.Nonce
 
-	// If the note does not exist, add it
-	if !exists {
-		note := Note{
-			Title:  updatedNote.Title,
-			Body:   updatedNote.Body,
-			Shared: false,
-		}
-
-		notes = append(notes, note)
+	if err := store.Put(note); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	saveNotes()
-
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintf(w, "Note synced: %s", updatedNote.Title)
 }
 
+// readNoteHandler serves /x/<user>/<title>, the public read URL for a note
 func readNoteHandler(w http.ResponseWriter, r *http.Request) {
-	title := r.URL.Path[3:]
-	fmt.Println("Title:", title)
-	if title == "" {
-		http.Error(w, "Missing title query parameter", http.StatusBadRequest)
+	path := strings.TrimPrefix(r.URL.Path, "/x/")
+	parts := strings.SplitN(path, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		http.Error(w, "Missing owner/title path", http.StatusBadRequest)
 		return
 	}
+	owner, title := parts[0], parts[1]
+	fmt.Println("Owner:", owner, "Title:", title)
 
-	notesLock.Lock()
-	defer notesLock.Unlock()
+	note, ok := store.Get(owner, title)
+	if !ok {
+		http.Error(w, "Note not found", http.StatusNotFound)
+		return
+	}
 
-	for _, note := range notes {
-		if note.Title == title {
-			if note.Shared {
-				renderNoteHTML(w, note)
-				return
-			} else {
-				user, pass, ok := r.BasicAuth()
-				if !ok || subtle.ConstantTimeCompare([]byte(user), []byte(username)) != 1 || !checkPassword(pass, passwordHash) {
-					w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
-					http.Error(w, "Unauthorized", http.StatusUnauthorized)
-					return
-				}
-
-				renderNoteHTML(w, note)
-				return
-			}
+	if !note.Shared {
+		requester, authOK := authenticate(r)
+		if !authOK || requester != owner {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
 		}
 	}
 
-	http.Error(w, "Note not found", http.StatusNotFound)
-	return
+	if note.Encrypted {
+		renderPassphrasePrompt(w, note)
+		return
+	}
+	renderNoteHTML(w, note)
 }
 
 func isMd(note Note) bool {
@@ -298,11 +597,20 @@ func renderNoteHTML(w http.ResponseWriter, note Note) {
       </div>
     </article>
     <script>
+      // getCsrfToken reads the double-submit cookie set at login so the
+      // /sync save fetch below can echo it back as X-CSRF-Token, per
+      // requireCSRF in service.go.
+      const getCsrfToken = () => {
+        const match = document.cookie.match(/(?:^|; )livenote_csrf=([^;]*)/);
+        return match ? decodeURIComponent(match[1]) : '';
+      };
+
       const saveNote = (title, body) => {
-        fetch('/sync-raw', {
+        fetch('/sync', {
           method: 'POST',
           headers: {
             'Content-Type': 'application/json',
+            'X-CSRF-Token': getCsrfToken(),
           },
           body: JSON.stringify({
             title: title,
@@ -311,6 +619,28 @@ func renderNoteHTML(w http.ResponseWriter, note Note) {
         });
       };
 
+      const clientId = Math.random().toString(36).slice(2);
+      const wsProto = location.protocol === 'https:' ? 'wss:' : 'ws:';
+      const socket = new WebSocket(wsProto + '//' + location.host + '/ws/%s/' + encodeURIComponent('%s'));
+      let socketOpen = false;
+
+      socket.addEventListener('open', () => { socketOpen = true; });
+      socket.addEventListener('close', () => { socketOpen = false; });
+      socket.addEventListener('message', (ev) => {
+        const d = JSON.parse(ev.data);
+        if (d.clientId === clientId) return;
+        if (d.op === 'replace') {
+          noteBody.innerHTML = d.text;
+        } else if (d.op === 'insert') {
+          noteBody.innerHTML = noteBody.innerHTML.slice(0, d.pos) + d.text + noteBody.innerHTML.slice(d.pos);
+        } else if (d.op === 'delete') {
+          noteBody.innerHTML = noteBody.innerHTML.slice(0, d.pos) + noteBody.innerHTML.slice(d.pos + d.text.length);
+        }
+        // Keep lastText in sync with the DOM we just patched so the next
+        // local diffOps() call compares against what the server has too.
+        lastText = noteBody.innerHTML;
+      });
+
       const debounce = (func, delay) => {
         let inDebounce;
         return function() {
@@ -340,29 +670,124 @@ func renderNoteHTML(w http.ResponseWriter, note Note) {
         };
       };
 
+      // diffOps reduces an edit to its common-prefix/common-suffix delta, so
+      // a single keystroke sends a one-character insert/delete instead of
+      // the whole note body - the rest of noteBody.innerHTML didn't change.
+      const diffOps = (oldText, newText) => {
+        let start = 0;
+        const maxStart = Math.min(oldText.length, newText.length);
+        while (start < maxStart && oldText[start] === newText[start]) start++;
+
+        let oldEnd = oldText.length, newEnd = newText.length;
+        while (oldEnd > start && newEnd > start && oldText[oldEnd - 1] === newText[newEnd - 1]) {
+          oldEnd--; newEnd--;
+        }
+
+        const ops = [];
+        if (oldEnd > start) ops.push({ op: 'delete', pos: start, text: oldText.slice(start, oldEnd) });
+        if (newEnd > start) ops.push({ op: 'insert', pos: start, text: newText.slice(start, newEnd) });
+        return ops;
+      };
+
       const noteTitle = '%s';
       const noteBody = document.querySelector('div[contenteditable]');
-      noteBody.addEventListener('input', debounce(() => {
-        saveNote(noteTitle, noteBody.innerHTML);
-      }, 2000));
+      let lastText = noteBody.innerHTML;
+
+      const persistFallback = debounce(() => saveNote(noteTitle, noteBody.innerHTML), 2000);
+
+      noteBody.addEventListener('input', () => {
+        const newText = noteBody.innerHTML;
+        if (socketOpen) {
+          diffOps(lastText, newText).forEach((op) => {
+            socket.send(JSON.stringify(Object.assign({ clientId: clientId }, op)));
+          });
+        } else {
+          persistFallback();
+        }
+        lastText = newText;
+      });
     </script>
   </body>
 </html>`
-	fmt.Fprintf(w, s, note.Title, note.Body, note.Title)
+	fmt.Fprintf(w, s, note.Title, note.Body, note.Owner, note.Title, note.Title)
 	w.Header().Set("Content-Type", "text/html")
 	w.WriteHeader(http.StatusOK)
 }
 
-// Middleware to enforce HTTP basic authentication
-func authMiddleware(next http.HandlerFunc, username string, passwordHash []byte) http.HandlerFunc {
+type ctxKey int
+
+const ctxOwnerKey ctxKey = 0
+
+// authenticate resolves the caller's username from a session cookie first,
+// falling back to HTTP Basic against the registered users (and, for a name
+// no registered user has, the legacy single-user USERNAME/PASSWORD pair).
+func authenticate(r *http.Request) (string, bool) {
+	if name, ok := userFromSession(r); ok {
+		return name, true
+	}
+
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		return "", false
+	}
+
+	if u, found := findUser(user); found {
+		if checkPassword(pass, u.PasswordHash) {
+			return user, true
+		}
+		return "", false
+	}
+
+	if username != "" && subtle.ConstantTimeCompare([]byte(user), []byte(username)) == 1 && checkPassword(pass, passwordHash) {
+		return user, true
+	}
+
+	return "", false
+}
+
+// requireMethod rejects any request whose method isn't m, for handlers that
+// change state and must not be reachable from a plain cross-site GET.
+func requireMethod(m string, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		user, pass, ok := r.BasicAuth()
-		if !ok || subtle.ConstantTimeCompare([]byte(user), []byte(username)) != 1 || !checkPassword(pass, passwordHash) {
+		if r.Method != m {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// requireCSRF enforces the double-submit CSRF cookie issued at session start
+// against the X-CSRF-Token header. It only applies to session-cookie auth -
+// a cross-site form or img tag can ride a browser's session cookie, but it
+// can't read the cookie to set the matching header. Basic auth callers (the
+// CLI client) aren't ambiently attached by a browser the same way, so they
+// pass through unchecked.
+func requireCSRF(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := userFromSession(r); ok {
+			cookie, err := r.Cookie(csrfCookieName)
+			if err != nil || cookie.Value == "" || cookie.Value != r.Header.Get("X-CSRF-Token") {
+				http.Error(w, "Missing or invalid CSRF token", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// Middleware to enforce authentication, cookie-first with a Basic fallback
+func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		owner, ok := authenticate(r)
+		if !ok {
 			w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
-		next.ServeHTTP(w, r)
+
+		ctx := context.WithValue(r.Context(), ctxOwnerKey, owner)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	}
 }
 
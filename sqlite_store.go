@@ -0,0 +1,179 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteStore persists notes row-by-row instead of rewriting a single blob,
+// so a crash mid-write can't lose the whole note set.
+type sqliteStore struct {
+	db *sql.DB
+}
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS notes (
+	owner TEXT NOT NULL,
+	title TEXT NOT NULL,
+	body BLOB NOT NULL,
+	shared INT NOT NULL DEFAULT 0,
+	rev INT NOT NULL DEFAULT 0,
+	encrypted INT NOT NULL DEFAULT 0,
+	salt BLOB,
+	nonce BLOB,
+	updated_at INT NOT NULL,
+	PRIMARY KEY (owner, title)
+);
+CREATE TABLE IF NOT EXISTS revisions (
+	owner TEXT NOT NULL,
+	title TEXT NOT NULL,
+	id INT NOT NULL,
+	timestamp INT NOT NULL,
+	author TEXT NOT NULL,
+	body BLOB NOT NULL,
+	parent_id INT NOT NULL,
+	salt BLOB,
+	nonce BLOB,
+	PRIMARY KEY (owner, title, id)
+);
+`
+
+func newSQLiteStore(path string) (*sqliteStore, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqliteStore{db: db}, nil
+}
+
+func (s *sqliteStore) Get(owner, title string) (Note, bool) {
+	var note Note
+	var updatedAt int64
+	var shared, encrypted int
+	row := s.db.QueryRow(`SELECT owner, title, body, shared, rev, encrypted, salt, nonce, updated_at
+		FROM notes WHERE owner = ? AND title = ?`, owner, title)
+	if err := row.Scan(&note.Owner, &note.Title, &note.Body, &shared, &note.Rev, &encrypted, &note.Salt, &note.Nonce, &updatedAt); err != nil {
+		return Note{}, false
+	}
+	note.Shared = shared != 0
+	note.Encrypted = encrypted != 0
+
+	note.Revisions, _ = s.listRevisions(owner, title)
+	return note, true
+}
+
+func (s *sqliteStore) listRevisions(owner, title string) ([]Revision, error) {
+	rows, err := s.db.Query(`SELECT id, timestamp, author, body, parent_id, salt, nonce
+		FROM revisions WHERE owner = ? AND title = ? ORDER BY id ASC`, owner, title)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revs []Revision
+	for rows.Next() {
+		var rev Revision
+		var ts int64
+		if err := rows.Scan(&rev.ID, &ts, &rev.Author, &rev.Body, &rev.ParentID, &rev.Salt, &rev.Nonce); err != nil {
+			return nil, err
+		}
+		rev.Timestamp = time.Unix(ts, 0)
+		revs = append(revs, rev)
+	}
+	return revs, rows.Err()
+}
+
+func (s *sqliteStore) Put(note Note) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	shared, encrypted := 0, 0
+	if note.Shared {
+		shared = 1
+	}
+	if note.Encrypted {
+		encrypted = 1
+	}
+
+	if _, err := tx.Exec(`INSERT INTO notes (owner, title, body, shared, rev, encrypted, salt, nonce, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(owner, title) DO UPDATE SET
+			body = excluded.body, shared = excluded.shared, rev = excluded.rev,
+			encrypted = excluded.encrypted, salt = excluded.salt, nonce = excluded.nonce,
+			updated_at = excluded.updated_at`,
+		note.Owner, note.Title, note.Body, shared, note.Rev, encrypted, note.Salt, note.Nonce, time.Now().Unix()); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Revisions are append-only: insert whichever ones aren't stored yet.
+	for _, rev := range note.Revisions {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO revisions (owner, title, id, timestamp, author, body, parent_id, salt, nonce)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			note.Owner, note.Title, rev.ID, rev.Timestamp.Unix(), rev.Author, rev.Body, rev.ParentID, rev.Salt, rev.Nonce); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqliteStore) Delete(owner, title string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM notes WHERE owner = ? AND title = ?`, owner, title); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM revisions WHERE owner = ? AND title = ?`, owner, title); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) List(owner string) ([]Note, error) {
+	var rows *sql.Rows
+	var err error
+	if owner == "" {
+		rows, err = s.db.Query(`SELECT owner, title FROM notes`)
+	} else {
+		rows, err = s.db.Query(`SELECT owner, title FROM notes WHERE owner = ?`, owner)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Note
+	for rows.Next() {
+		var o, t string
+		if err := rows.Scan(&o, &t); err != nil {
+			return nil, err
+		}
+		if n, ok := s.Get(o, t); ok {
+			out = append(out, n)
+		}
+	}
+	return out, rows.Err()
+}
+
+func (s *sqliteStore) SetShared(owner, title string, shared bool) error {
+	v := 0
+	if shared {
+		v = 1
+	}
+	_, err := s.db.Exec(`UPDATE notes SET shared = ? WHERE owner = ? AND title = ?`, v, owner, title)
+	return err
+}
@@ -0,0 +1,39 @@
+package main
+
+import "log"
+
+// Store abstracts note persistence so the server isn't tied to the JSON
+// file format. STORAGE=json|sqlite picks the implementation at startup.
+type Store interface {
+	Get(owner, title string) (Note, bool)
+	Put(note Note) error
+	Delete(owner, title string) error
+	// List returns every note owned by owner, or every note if owner is "".
+	List(owner string) ([]Note, error)
+	SetShared(owner, title string, shared bool) error
+}
+
+// openStore selects a Store implementation from STORAGE/STORAGE_PATH, as
+// set in .env, defaulting to the legacy JSON file for compatibility.
+func openStore() Store {
+	switch storageKindEnv {
+	case "sqlite":
+		// filename defaults to the legacy JSON path - reusing it here would
+		// point sql.Open at a file that's either already JSON (fails to open
+		// as a database) or about to become one, so STORAGE_PATH is required.
+		if storagePathEnv == "" {
+			log.Fatal("STORAGE_PATH must be set when STORAGE=sqlite")
+		}
+		s, err := newSQLiteStore(storagePathEnv)
+		if err != nil {
+			log.Fatal("Error opening sqlite store:", err)
+		}
+		return s
+	default:
+		path := storagePathEnv
+		if path == "" {
+			path = filename
+		}
+		return newJSONStore(path)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// storeFixture is shared across every Store implementation under test so a
+// bug can't hide behind an implementation-specific dataset.
+var storeFixture = []Note{
+	{Owner: "alice", Title: "todo.md", Body: "- buy milk", Rev: 1},
+	{
+		Owner: "alice", Title: "diary.md", Body: "dear diary", Rev: 2, Shared: true,
+		Revisions: []Revision{{ID: 1, Author: "alice", Body: "dear diary"}},
+	},
+	{Owner: "bob", Title: "todo.md", Body: "- walk dog", Rev: 1},
+}
+
+// newTestStores builds one of each Store backend rooted in a fresh temp dir.
+func newTestStores(t *testing.T) map[string]Store {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "livenote-store-test")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	sqlite, err := newSQLiteStore(filepath.Join(dir, "notes.db"))
+	if err != nil {
+		t.Fatalf("newSQLiteStore: %v", err)
+	}
+
+	return map[string]Store{
+		"json":   newJSONStore(filepath.Join(dir, "notes.json")),
+		"sqlite": sqlite,
+	}
+}
+
+// TestStore exercises Get/Put/Delete/List/SetShared against the same
+// fixture set on every Store implementation, so both backends are held to
+// the same contract.
+func TestStore(t *testing.T) {
+	for name, s := range newTestStores(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, n := range storeFixture {
+				if err := s.Put(n); err != nil {
+					t.Fatalf("Put(%s/%s): %v", n.Owner, n.Title, err)
+				}
+			}
+
+			got, ok := s.Get("alice", "todo.md")
+			if !ok {
+				t.Fatalf("Get(alice/todo.md): not found")
+			}
+			if got.Body != "- buy milk" {
+				t.Errorf("Get(alice/todo.md).Body = %q, want %q", got.Body, "- buy milk")
+			}
+
+			if _, ok := s.Get("alice", "missing.md"); ok {
+				t.Errorf("Get(alice/missing.md): found, want not found")
+			}
+
+			aliceNotes, err := s.List("alice")
+			if err != nil {
+				t.Fatalf("List(alice): %v", err)
+			}
+			if len(aliceNotes) != 2 {
+				t.Errorf("List(alice) = %d notes, want 2", len(aliceNotes))
+			}
+
+			everyone, err := s.List("")
+			if err != nil {
+				t.Fatalf(`List(""): %v`, err)
+			}
+			if len(everyone) != len(storeFixture) {
+				t.Errorf(`List("") = %d notes, want %d`, len(everyone), len(storeFixture))
+			}
+
+			diary, ok := s.Get("alice", "diary.md")
+			if !ok || len(diary.Revisions) != 1 || diary.Revisions[0].Body != "dear diary" {
+				t.Errorf("Get(alice/diary.md).Revisions = %+v, want one revision with body %q", diary.Revisions, "dear diary")
+			}
+
+			if err := s.SetShared("bob", "todo.md", true); err != nil {
+				t.Fatalf("SetShared(bob/todo.md, true): %v", err)
+			}
+			if got, _ := s.Get("bob", "todo.md"); !got.Shared {
+				t.Errorf("Get(bob/todo.md).Shared = false, want true after SetShared")
+			}
+
+			if err := s.Delete("alice", "todo.md"); err != nil {
+				t.Fatalf("Delete(alice/todo.md): %v", err)
+			}
+			if _, ok := s.Get("alice", "todo.md"); ok {
+				t.Errorf("Get(alice/todo.md) after Delete: found, want not found")
+			}
+		})
+	}
+}